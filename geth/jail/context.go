@@ -0,0 +1,259 @@
+package jail
+
+import (
+	"context"
+	"time"
+
+	"github.com/status-im/status-go/geth/common"
+	"github.com/status-im/status-go/geth/jail/internal/vm"
+)
+
+// CallErrorKind distinguishes why a Context-aware call failed.
+type CallErrorKind int
+
+const (
+	// CallErrorJS means the cell's JavaScript threw, or failed to parse.
+	CallErrorJS CallErrorKind = iota
+	// CallErrorCancelled means ctx was done, or a CallWithTimeout deadline
+	// passed, before execution finished. The underlying JS was interrupted
+	// mid-run and the cell may be left in a partial state.
+	CallErrorCancelled
+	// CallErrorRPC means looking up or preparing the cell itself failed,
+	// before any JavaScript ran.
+	CallErrorRPC
+)
+
+// CallError is returned by CallContext's typed counterparts (currently
+// CallWithTimeout) instead of the JSON-string errors Call and Send return,
+// so callers can tell cancellation, JS exceptions and RPC errors apart
+// without string-matching.
+type CallError struct {
+	Kind CallErrorKind
+	Err  error
+}
+
+func (e *CallError) Error() string { return e.Err.Error() }
+func (e *CallError) Unwrap() error { return e.Err }
+
+// callSlot tracks the context governing whichever ParseContext/CallContext/
+// CallWithTimeout call is currently executing against a chatID. Jail.calls
+// maps chatID to its current slot. A call only acts on the strength of its
+// own slot still being the one registered in Jail.calls (see endCall),
+// which is what makes "the call finished normally" and "ctx fired" mutually
+// exclusive instead of a data race.
+type callSlot struct {
+	ctx context.Context
+}
+
+// beginCall registers ctx as the context governing chatID's in-flight
+// top-level call and returns the slot identifying it.
+func (jail *Jail) beginCall(ctx context.Context, chatID string) *callSlot {
+	slot := &callSlot{ctx: ctx}
+	jail.Lock()
+	jail.calls[chatID] = slot
+	jail.Unlock()
+	return slot
+}
+
+// endCall retires slot, but only if it's still the one registered for
+// chatID, and reports whether it won that race. It's called from both the
+// goroutine that produces the call's real result and the select branch
+// that reacts to ctx.Done(), and its return value only ever gates whether
+// that caller goes on to call interruptCell — never whether the result is
+// delivered, which both sides must do unconditionally to avoid deadlocking
+// each other. Without the gating, a select that's ready on both branches at
+// once (e.g. the call finishes right as the deadline passes) could
+// interrupt the cell on behalf of a call that had already completed, and
+// that stale Otto interrupt would then fire against a later, unrelated
+// Parse/Call/Send against the same chatID instead.
+func (jail *Jail) endCall(chatID string, slot *callSlot) bool {
+	jail.Lock()
+	defer jail.Unlock()
+	if jail.calls[chatID] != slot {
+		return false
+	}
+	delete(jail.calls, chatID)
+	return true
+}
+
+// contextFor returns the context governing chatID's currently executing
+// top-level call, or context.Background() if none is in flight (e.g. calls
+// made through the context-oblivious Parse/Call/Send entry points). Send
+// consults it so an RPC call triggered from JS inherits the same
+// cancellation/deadline as the ParseContext/CallContext/CallWithTimeout
+// call that triggered it.
+func (jail *Jail) contextFor(chatID string) context.Context {
+	jail.RLock()
+	slot, ok := jail.calls[chatID]
+	jail.RUnlock()
+	if !ok {
+		return context.Background()
+	}
+	return slot.ctx
+}
+
+// interruptCell aborts chatID's in-flight JS execution, if any, by sending
+// an Otto Interrupt that unwinds with cause as its error. Cell.Run/Cell.Call
+// recover a panicked error and return it from the otto call they wrap, so
+// the interrupted call unwinds cleanly instead of a goroutine running stale
+// JS forever.
+func (jail *Jail) interruptCell(chatID string, cause error) {
+	jailCell, err := jail.Cell(chatID)
+	if err != nil {
+		return
+	}
+	cell, ok := jailCell.(*Cell)
+	if !ok {
+		return
+	}
+	cell.vm.Interrupt(cause)
+}
+
+// executeWithContext runs jail.policy.Execute, but gives up waiting as soon
+// as ctx is done instead of blocking for however long the call takes.
+//
+// Send runs synchronously on whatever goroutine is inside Cell.Run/Cell.Call
+// at the time JS calls jeth.internalRequest, so anything that makes it
+// return sooner frees that cell's lock sooner too. This is what stops a
+// slow upstream RPC round-trip — the scenario ParseContext/CallContext/
+// CallWithTimeout exist to guard against — from holding the cell's lock
+// indefinitely: once ctx is done, Send gives up on the RPC call and returns
+// a cancellation error to the dapp immediately.
+//
+// TODO: the RPC call itself is not killed — Go has no way to preempt a
+// blocked native call, and ExecutionPolicy.Execute does not yet take a ctx to
+// forward into the underlying RPC client call (e.g. Client.CallContext). It
+// keeps running on its own goroutine, and for a state-changing method such as
+// eth_sendTransaction, it still completes after the dapp was told it was
+// cancelled. Fixing that requires threading ctx through ExecutionPolicy.
+func (jail *Jail) executeWithContext(ctx context.Context, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+	if ctx.Done() == nil {
+		return jail.policy.Execute(req, vm)
+	}
+
+	type outcome struct {
+		res interface{}
+		err error
+	}
+	resCh := make(chan outcome, 1)
+	go func() {
+		res, err := jail.policy.Execute(req, vm)
+		resCh <- outcome{res, err}
+	}()
+
+	select {
+	case out := <-resCh:
+		return out.res, out.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ParseContext behaves like Parse, but abandons evaluation of js as soon as
+// ctx is done, interrupting the cell's VM instead of leaving it to run to
+// completion. A cancelled cell may be left partially initialized; treat its
+// chatID as unusable afterwards.
+func (jail *Jail) ParseContext(ctx context.Context, chatID, js string) string {
+	slot := jail.beginCall(ctx, chatID)
+
+	resCh := make(chan string, 1)
+	go func() {
+		res := jail.Parse(chatID, js)
+		jail.endCall(chatID, slot)
+		resCh <- res
+	}()
+
+	select {
+	case res := <-resCh:
+		return res
+	case <-ctx.Done():
+		if jail.endCall(chatID, slot) {
+			jail.interruptCell(chatID, ctx.Err())
+			return makeError(ctx.Err().Error())
+		}
+		// jail.Parse had already finished (or another call for the same
+		// chatID took over the slot) right as ctx fired: wait for the
+		// result that's always sent, rather than a cancellation error.
+		return <-resCh
+	}
+}
+
+// CallContext behaves like Call, but abandons the call as soon as ctx is
+// done, interrupting the cell's VM instead of leaving it to run to
+// completion.
+func (jail *Jail) CallContext(ctx context.Context, chatID, this, args string) string {
+	slot := jail.beginCall(ctx, chatID)
+
+	resCh := make(chan string, 1)
+	go func() {
+		res := jail.Call(chatID, this, args)
+		jail.endCall(chatID, slot)
+		resCh <- res
+	}()
+
+	select {
+	case res := <-resCh:
+		return res
+	case <-ctx.Done():
+		if jail.endCall(chatID, slot) {
+			jail.interruptCell(chatID, ctx.Err())
+			return makeError(ctx.Err().Error())
+		}
+		// jail.Call had already finished (or another call for the same
+		// chatID took over the slot) right as ctx fired: wait for the
+		// result that's always sent, rather than a cancellation error.
+		return <-resCh
+	}
+}
+
+// CallWithTimeout calls chatID's `call` function, aborting it if it doesn't
+// finish within d. Unlike Call, it returns a typed *CallError so callers can
+// distinguish cancellation, JS exceptions and RPC errors instead of parsing
+// a JSON string.
+func (jail *Jail) CallWithTimeout(chatID, this, args string, d time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	cell, err := jail.Cell(chatID)
+	if err != nil {
+		return "", &CallError{Kind: CallErrorRPC, Err: err}
+	}
+
+	slot := jail.beginCall(ctx, chatID)
+
+	type result struct {
+		val string
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		v, err := cell.Call("call", nil, this, args)
+		res := result{err: err}
+		if err == nil {
+			res.val = v.String()
+		}
+		jail.endCall(chatID, slot)
+		resCh <- res
+	}()
+
+	select {
+	case r := <-resCh:
+		if r.err != nil {
+			return "", &CallError{Kind: CallErrorJS, Err: r.err}
+		}
+		return r.val, nil
+	case <-ctx.Done():
+		if jail.endCall(chatID, slot) {
+			jail.interruptCell(chatID, ctx.Err())
+			return "", &CallError{Kind: CallErrorCancelled, Err: ctx.Err()}
+		}
+		// cell.Call had already finished (or another call for the same
+		// chatID took over the slot) right as ctx fired: wait for the
+		// result that's always sent, rather than a cancellation error.
+		r := <-resCh
+		if r.err != nil {
+			return "", &CallError{Kind: CallErrorJS, Err: r.err}
+		}
+		return r.val, nil
+	}
+}
@@ -0,0 +1,90 @@
+package jail
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func newTestJailForCalls() *Jail {
+	return &Jail{calls: make(map[string]*callSlot)}
+}
+
+func TestContextForReturnsBackgroundWhenNoCallInFlight(t *testing.T) {
+	jail := newTestJailForCalls()
+
+	if got := jail.contextFor("chat-1"); got != context.Background() {
+		t.Fatalf("expected context.Background() for an unknown chatID, got %v", got)
+	}
+}
+
+func TestBeginCallThenContextForReturnsItsCtx(t *testing.T) {
+	jail := newTestJailForCalls()
+
+	ctx := context.WithValue(context.Background(), struct{ key string }{"k"}, "v")
+	jail.beginCall(ctx, "chat-1")
+
+	if got := jail.contextFor("chat-1"); got != ctx {
+		t.Fatal("expected contextFor to return the ctx registered by beginCall")
+	}
+}
+
+func TestEndCallOnlyWinsOnce(t *testing.T) {
+	jail := newTestJailForCalls()
+	slot := jail.beginCall(context.Background(), "chat-1")
+
+	if !jail.endCall("chat-1", slot) {
+		t.Fatal("expected the first endCall for a still-registered slot to win")
+	}
+	if jail.endCall("chat-1", slot) {
+		t.Fatal("expected a second endCall for the same slot to lose, since it was already retired")
+	}
+}
+
+// TestEndCallLosesToANewerCall exercises the scenario the comment on endCall
+// describes: a call that's superseded by a newer beginCall for the same
+// chatID must not be able to retire the newer call's slot.
+func TestEndCallLosesToANewerCall(t *testing.T) {
+	jail := newTestJailForCalls()
+	oldSlot := jail.beginCall(context.Background(), "chat-1")
+	newSlot := jail.beginCall(context.Background(), "chat-1")
+
+	if jail.endCall("chat-1", oldSlot) {
+		t.Fatal("expected endCall for a superseded slot to report false")
+	}
+	if !jail.endCall("chat-1", newSlot) {
+		t.Fatal("expected endCall for the current slot to report true")
+	}
+}
+
+// TestConcurrentEndCallExactlyOneWinner covers the race endCall exists to
+// resolve: the goroutine producing a call's real result and the select
+// branch reacting to ctx.Done() calling endCall at the same time must agree
+// on exactly one winner.
+func TestConcurrentEndCallExactlyOneWinner(t *testing.T) {
+	jail := newTestJailForCalls()
+	slot := jail.beginCall(context.Background(), "chat-1")
+
+	const attempts = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if jail.endCall("chat-1", slot) {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Fatalf("expected exactly one concurrent endCall to win, got %d", winners)
+	}
+}
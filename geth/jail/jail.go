@@ -26,12 +26,19 @@ var (
 type Jail struct {
 	// FIXME(tiabc): This mutex handles cells field access and must be renamed appropriately: cellsMutex
 	sync.RWMutex
-	nodeManager    common.NodeManager
-	accountManager common.AccountManager
-	txQueueManager common.TxQueueManager
-	policy         *ExecutionPolicy
-	cells          map[string]*Cell // jail supports running many isolated instances of jailed runtime
-	baseJSCode     string           // JavaScript used to initialize all new cells with
+	nodeManager     common.NodeManager
+	accountManager  common.AccountManager
+	txQueueManager  common.TxQueueManager
+	policy          *ExecutionPolicy
+	cells           map[string]*Cell        // jail supports running many isolated instances of jailed runtime
+	vms             map[*otto.Otto]string   // maps a cell's underlying VM back to its chatID, used by Send to route subscription requests
+	subs            *subscriptionRegistry   // live eth_subscribe/shh_subscribe subscriptions, keyed by subscription id
+	middlewares     []Middleware            // registered via Use, applied to every cell's RPC calls
+	cellMiddlewares map[string][]Middleware // registered via UseCell, applied only to the named chatID's calls
+	sources         map[string]string       // last js passed to Parse per chatID, replayed by RestoreCell
+	store           Store                   // optional snapshot persistence, set via SetStore
+	calls           map[string]*callSlot    // chatID -> the context governing its in-flight ParseContext/CallContext/CallWithTimeout call, if any
+	baseJSCode      string                  // JavaScript used to initialize all new cells with
 }
 
 // New returns new Jail environment with the associated NodeManager and
@@ -43,11 +50,16 @@ func New(
 		panic("Jail is missing mandatory dependencies")
 	}
 	return &Jail{
-		nodeManager:    nodeManager,
-		accountManager: accountManager,
-		txQueueManager: txQueueManager,
-		cells:          make(map[string]*Cell),
-		policy:         NewExecutionPolicy(nodeManager, accountManager, txQueueManager),
+		nodeManager:     nodeManager,
+		accountManager:  accountManager,
+		txQueueManager:  txQueueManager,
+		cells:           make(map[string]*Cell),
+		vms:             make(map[*otto.Otto]string),
+		subs:            newSubscriptionRegistry(),
+		cellMiddlewares: make(map[string][]Middleware),
+		sources:         make(map[string]string),
+		calls:           make(map[string]*callSlot),
+		policy:          NewExecutionPolicy(nodeManager, accountManager, txQueueManager),
 	}
 }
 
@@ -71,11 +83,23 @@ func (jail *Jail) NewCell(chatID string) (common.JailCell, error) {
 
 	jail.Lock()
 	jail.cells[chatID] = cell
+	jail.vms[vm] = chatID
 	jail.Unlock()
 
 	return cell, nil
 }
 
+// chatIDFor returns the chatID of the cell backing o, if any. It only ever
+// compares pointer identity, never touches the VM itself, so it's safe to
+// call from Send without the synchronization Otto otherwise requires.
+func (jail *Jail) chatIDFor(o *otto.Otto) (string, bool) {
+	jail.RLock()
+	defer jail.RUnlock()
+
+	chatID, ok := jail.vms[o]
+	return chatID, ok
+}
+
 // Cell returns the existing instance of Cell.
 func (jail *Jail) Cell(chatID string) (common.JailCell, error) {
 	jail.RLock()
@@ -105,6 +129,10 @@ func (jail *Jail) Parse(chatID, js string) string {
 		cell, _ = jail.Cell(chatID)
 	}
 
+	jail.Lock()
+	jail.sources[chatID] = js
+	jail.Unlock()
+
 	// init jeth and its handlers
 	if err = cell.Set("jeth", struct{}{}); err != nil {
 		return makeError(err.Error())
@@ -114,6 +142,14 @@ func (jail *Jail) Parse(chatID, js string) string {
 		return makeError(err.Error())
 	}
 
+	concreteCell, ok := cell.(*Cell)
+	if !ok {
+		return makeError(fmt.Sprintf("cell[%s] is not a *Cell", chatID))
+	}
+	if err = registerProviderHandlers(jail, concreteCell, chatID); err != nil {
+		return makeError(err.Error())
+	}
+
 	initJs := jail.baseJSCode + ";"
 	if _, err = cell.Run(initJs); err != nil {
 		return makeError(err.Error())
@@ -153,8 +189,12 @@ func (jail *Jail) Call(chatID, this, args string) string {
 
 // Send will serialize the first argument, send it to the node and returns the response.
 // IMPORTANT: Don't use `call.Otto` in this function unless you want to run into race conditions. Use `vm` instead.
+// The one exception is chatIDFor(call.Otto), which only ever does a pointer
+// lookup and never touches the VM.
 // nolint: errcheck, unparam
 func (jail *Jail) Send(call otto.FunctionCall, vm *vm.VM) otto.Value {
+	chatID, _ := jail.chatIDFor(call.Otto)
+
 	reqVal, err := vm.Call("JSON.stringify", nil, call.Argument(0))
 	if err != nil {
 		throwJSException(err)
@@ -183,10 +223,66 @@ func (jail *Jail) Send(call otto.FunctionCall, vm *vm.VM) otto.Value {
 		throwJSException(fmt.Errorf("can't create Array: %s", err))
 	}
 
+	// ctx is whatever ParseContext/CallContext/CallWithTimeout call is
+	// currently executing for chatID, if any, so a slow upstream RPC round
+	// trip triggered from JS can be abandoned on the same deadline instead
+	// of holding this cell's lock until the call returns.
+	ctx := jail.contextFor(chatID)
+	handler := jail.buildHandler(func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+		return jail.executeWithContext(ctx, req, vm)
+	})
+
+	// inFlight coalesces duplicate idempotent reads pinned to a fixed block
+	// within this single batch, so e.g. a dapp requesting the same
+	// eth_getBalance(addr, "0x1") twice only walks the middleware chain
+	// once. Reads tagged "latest"/"pending" are excluded, same as
+	// CachingMiddleware, since coalescing those could return a stale result
+	// to a later call in the same batch that expects to observe the effect
+	// of an intervening state-changing call (e.g. eth_sendTransaction).
+	type outcome struct {
+		res interface{}
+		err error
+	}
+	inFlight := make(map[string]outcome)
+
 	// Execute the requests.
 	for _, req := range reqs {
 		log.Info("execute request", "method", req.Method)
-		res, err := jail.policy.Execute(req, vm)
+
+		var res interface{}
+		switch req.Method {
+		case "eth_subscribe", "shh_subscribe":
+			var subID string
+			subID, err = jail.Subscribe(chatID, req)
+			if err == nil {
+				res = newSubscriptionResult(req.ID, subID)
+			}
+		case "eth_unsubscribe", "shh_unsubscribe":
+			err = jail.Unsubscribe(req)
+			if err == nil {
+				res = newSubscriptionResult(req.ID, "true")
+			}
+		default:
+			key, coalescable := "", false
+			if cacheableReadMethods[req.Method] && pinnedToBlock(req) {
+				if k, kerr := cacheKey(req); kerr == nil {
+					key, coalescable = k, true
+				}
+			}
+
+			if coalescable {
+				if out, ok := inFlight[key]; ok {
+					res, err = out.res, out.err
+					break
+				}
+			}
+
+			res, err = handler(chatID, req, vm)
+
+			if coalescable {
+				inFlight[key] = outcome{res: res, err: err}
+			}
+		}
 		if err != nil {
 			log.Info("request errored", "error", err.Error())
 			switch err.(type) {
@@ -227,6 +323,17 @@ func newErrorResponse(msg string, id interface{}) map[string]interface{} {
 	}
 }
 
+// newSubscriptionResult bundles subID into a JSON-RPC response: the new
+// subscription id for eth_subscribe/shh_subscribe replies, or the string
+// "true" for eth_unsubscribe/shh_unsubscribe replies.
+func newSubscriptionResult(id interface{}, subID string) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  subID,
+	}
+}
+
 func newErrorResponseOtto(vm *vm.VM, msg string, id interface{}) otto.Value {
 	// TODO(tiabc): Handle errors.
 	errResp, _ := json.Marshal(newErrorResponse(msg, id))
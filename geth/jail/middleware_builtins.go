@@ -0,0 +1,178 @@
+package jail
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/status-im/status-go/geth/common"
+	"github.com/status-im/status-go/geth/jail/internal/vm"
+	"github.com/status-im/status-go/geth/log"
+)
+
+// LoggingMiddleware logs every request's method, how long it took, and
+// whether it errored.
+func LoggingMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			start := time.Now()
+			res, err := next(chatID, req, vm)
+			log.Info("rpc call", "chatID", chatID, "method", req.Method, "duration", time.Since(start), "error", err)
+			return res, err
+		}
+	}
+}
+
+// MethodFilterMiddleware rejects any call whose method is in deny, or, when
+// allow is non-empty, whose method isn't in allow. deny takes precedence
+// over allow.
+func MethodFilterMiddleware(allow, deny []string) Middleware {
+	allowed := toMethodSet(allow)
+	denied := toMethodSet(deny)
+
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			if denied[req.Method] || (len(allowed) > 0 && !allowed[req.Method]) {
+				return nil, fmt.Errorf("method %s is not allowed", req.Method)
+			}
+			return next(chatID, req, vm)
+		}
+	}
+}
+
+func toMethodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+	return set
+}
+
+// RateLimitMiddleware caps how many calls a single chatID can make within
+// window, using a fixed-window counter per chatID.
+func RateLimitMiddleware(limit int, window time.Duration) Middleware {
+	type bucket struct {
+		count     int
+		expiresAt time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		buckets = make(map[string]*bucket)
+	)
+
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			now := time.Now()
+
+			mu.Lock()
+			b, ok := buckets[chatID]
+			if !ok || now.After(b.expiresAt) {
+				b = &bucket{expiresAt: now.Add(window)}
+				buckets[chatID] = b
+			}
+			b.count++
+			exceeded := b.count > limit
+			mu.Unlock()
+
+			if exceeded {
+				return nil, fmt.Errorf("rate limit exceeded for chat %s: more than %d calls per %s", chatID, limit, window)
+			}
+			return next(chatID, req, vm)
+		}
+	}
+}
+
+// cacheableReadMethods are the idempotent reads CachingMiddleware is allowed
+// to cache, provided their last parameter pins a specific block rather than
+// "latest" or "pending".
+var cacheableReadMethods = map[string]bool{
+	"eth_call":         true,
+	"eth_getBalance":   true,
+	"eth_getCode":      true,
+	"eth_getStorageAt": true,
+}
+
+// CachingMiddleware caches responses to idempotent reads (see
+// cacheableReadMethods) pinned to a specific block, for ttl, keyed by method
+// and params.
+func CachingMiddleware(ttl time.Duration) Middleware {
+	type entry struct {
+		res     interface{}
+		err     error
+		expires time.Time
+	}
+
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]entry)
+	)
+
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			if !cacheableReadMethods[req.Method] || !pinnedToBlock(req) {
+				return next(chatID, req, vm)
+			}
+
+			key, err := cacheKey(req)
+			if err != nil {
+				return next(chatID, req, vm)
+			}
+
+			mu.Lock()
+			if e, ok := cache[key]; ok && time.Now().Before(e.expires) {
+				mu.Unlock()
+				return e.res, e.err
+			}
+			mu.Unlock()
+
+			res, err := next(chatID, req, vm)
+
+			mu.Lock()
+			cache[key] = entry{res: res, err: err, expires: time.Now().Add(ttl)}
+			mu.Unlock()
+
+			return res, err
+		}
+	}
+}
+
+// pinnedToBlock reports whether req's last parameter is an explicit block
+// number or hash rather than "latest"/"pending", which is what makes its
+// result safe to cache.
+func pinnedToBlock(req common.RPCCall) bool {
+	if len(req.Params) == 0 {
+		return false
+	}
+	tag, ok := req.Params[len(req.Params)-1].(string)
+	if !ok {
+		return false
+	}
+	return tag != "latest" && tag != "pending"
+}
+
+func cacheKey(req common.RPCCall) (string, error) {
+	raw, err := json.Marshal(req.Params)
+	if err != nil {
+		return "", err
+	}
+	return req.Method + string(raw), nil
+}
+
+// MetricsRecorder receives per-call observations from MetricsMiddleware.
+type MetricsRecorder interface {
+	ObserveRPCCall(method string, duration time.Duration, err error)
+}
+
+// MetricsMiddleware reports every call's duration and outcome to recorder.
+func MetricsMiddleware(recorder MetricsRecorder) Middleware {
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			start := time.Now()
+			res, err := next(chatID, req, vm)
+			recorder.ObserveRPCCall(req.Method, time.Since(start), err)
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package jail
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/status-im/status-go/geth/common"
+	"github.com/status-im/status-go/geth/jail/internal/vm"
+)
+
+// recordingHandler returns a Handler that appends its own name to calls
+// every time it runs, so tests can assert on invocation order and count.
+func recordingHandler(name string, calls *[]string) Handler {
+	return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+		*calls = append(*calls, name)
+		return name, nil
+	}
+}
+
+// wrapRecording wraps next with a Middleware that records name before
+// calling through, so the resulting order in calls reflects the actual
+// outer-to-inner traversal of the chain.
+func wrapRecording(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+			*calls = append(*calls, name)
+			return next(chatID, req, vm)
+		}
+	}
+}
+
+func TestBuildHandlerOrdersJailWideBeforeCellMiddleware(t *testing.T) {
+	jail := &Jail{cellMiddlewares: make(map[string][]Middleware)}
+
+	var calls []string
+	jail.Use(wrapRecording("jail-first", &calls))
+	jail.Use(wrapRecording("jail-second", &calls))
+	jail.UseCell("chat-1", wrapRecording("cell-only", &calls))
+
+	handler := jail.buildHandler(recordingHandler("base", &calls))
+	if _, err := handler("chat-1", common.RPCCall{Method: "eth_getBalance"}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"jail-first", "jail-second", "cell-only", "base"}
+	if len(calls) != len(want) {
+		t.Fatalf("got %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("got %v, want %v", calls, want)
+		}
+	}
+}
+
+func TestBuildHandlerSkipsOtherChatsCellMiddleware(t *testing.T) {
+	jail := &Jail{cellMiddlewares: make(map[string][]Middleware)}
+
+	var calls []string
+	jail.UseCell("chat-1", wrapRecording("chat-1-only", &calls))
+
+	handler := jail.buildHandler(recordingHandler("base", &calls))
+	if _, err := handler("chat-2", common.RPCCall{Method: "eth_getBalance"}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(calls) != 1 || calls[0] != "base" {
+		t.Fatalf("got %v, want [base] (chat-1's middleware must not run for chat-2)", calls)
+	}
+}
+
+func TestCachingMiddlewareCachesOnlyPinnedReads(t *testing.T) {
+	var underlying int
+	base := func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+		underlying++
+		return fmt.Sprintf("call-%d", underlying), nil
+	}
+
+	handler := CachingMiddleware(time.Minute)(base)
+
+	pinned := common.RPCCall{Method: "eth_getBalance", Params: []interface{}{"0xabc", "0x1"}}
+	res1, err := handler("chat-1", pinned, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	res2, err := handler("chat-1", pinned, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if res1 != res2 || underlying != 1 {
+		t.Fatalf("expected cached result on second call, got %v then %v (underlying called %d times)", res1, res2, underlying)
+	}
+
+	latest := common.RPCCall{Method: "eth_getBalance", Params: []interface{}{"0xabc", "latest"}}
+	if _, err := handler("chat-1", latest, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if underlying != 2 {
+		t.Fatalf("expected a call pinned to \"latest\" to bypass the cache, underlying called %d times", underlying)
+	}
+}
+
+func TestRateLimitMiddlewareBlocksOverLimit(t *testing.T) {
+	base := func(chatID string, req common.RPCCall, vm *vm.VM) (interface{}, error) {
+		return nil, nil
+	}
+	handler := RateLimitMiddleware(2, time.Minute)(base)
+
+	for i := 0; i < 2; i++ {
+		if _, err := handler("chat-1", common.RPCCall{Method: "eth_call"}, nil); err != nil {
+			t.Fatalf("call %d: unexpected error: %s", i, err)
+		}
+	}
+
+	if _, err := handler("chat-1", common.RPCCall{Method: "eth_call"}, nil); err == nil {
+		t.Fatal("expected the third call within the window to be rate limited")
+	}
+
+	if _, err := handler("chat-2", common.RPCCall{Method: "eth_call"}, nil); err != nil {
+		t.Fatalf("a different chatID must have its own bucket, got error: %s", err)
+	}
+}
@@ -0,0 +1,88 @@
+package jail
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/robertkrimen/otto"
+)
+
+// providerJS layers the EIP-1193 surface on top of the primitives registered
+// by registerProviderHandlers: `jeth.request({method, params})` returning a
+// Promise, and `jeth.on('notification'|'connect'|'disconnect', handler)`.
+// Keeping request()/on() in JS lets request() return a real Promise without
+// Otto needing any special-casing for Go callbacks.
+const providerJS = `
+(function () {
+    var listeners = {notification: [], connect: [], disconnect: []};
+
+    jeth.request = function (payload) {
+        payload = payload || {};
+        return new Promise(function (resolve, reject) {
+            var resp = jeth.internalRequest({
+                method: payload.method,
+                params: payload.params || []
+            });
+            if (resp && resp.error) {
+                reject(resp.error);
+            } else {
+                resolve(resp ? resp.result : undefined);
+            }
+        });
+    };
+
+    jeth.on = function (event, handler) {
+        if (!listeners.hasOwnProperty(event)) {
+            throw new Error('jeth.on: unknown event "' + event + '"');
+        }
+        listeners[event].push(handler);
+        return jeth;
+    };
+
+    jeth.internalEmit = function (event, payload) {
+        var handlers = listeners[event] || [];
+        for (var i = 0; i < handlers.length; i++) {
+            handlers[i](payload);
+        }
+    };
+})();
+`
+
+// registerProviderHandlers wires the Go side of the EIP-1193 provider onto
+// jeth: internalRequest performs a single JSON-RPC round-trip through
+// Jail.Send, and internalEmit (defined by providerJS) is what Go calls into
+// whenever a subscription produces a connect/disconnect/notification event.
+func registerProviderHandlers(jail *Jail, cell *Cell, chatID string) error {
+	jeth, err := cell.Get("jeth")
+	if err != nil {
+		return err
+	}
+
+	err = jeth.Object().Set("internalRequest", func(call otto.FunctionCall) otto.Value {
+		return jail.Send(call, cell.vm)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cell.Run(providerJS)
+	return err
+}
+
+// emitProviderEvent runs jeth.internalEmit(event, payload) inside cell,
+// surfacing payload to JS listeners registered via jeth.on(event, ...).
+func emitProviderEvent(cell *Cell, event string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = cell.Run(fmt.Sprintf("jeth.internalEmit(%q, (%s));", event, string(raw)))
+	return err
+}
+
+// deliverNotification surfaces a single eth_subscription notification to the
+// dapp as a 'notification' event carrying {subscription, result}.
+func deliverNotification(cell *Cell, subID string, result json.RawMessage) error {
+	payload := json.RawMessage(fmt.Sprintf(`{"subscription": %q, "result": %s}`, subID, string(result)))
+	return emitProviderEvent(cell, "notification", payload)
+}
@@ -0,0 +1,191 @@
+package jail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+)
+
+// Store persists and loads cell snapshots, keyed by chatID. Implementations
+// must be safe for concurrent use. FileStore is the bundled implementation;
+// a leveldb-backed one can satisfy the same interface.
+type Store interface {
+	Save(chatID string, snapshot []byte) error
+	Load(chatID string) ([]byte, error)
+}
+
+// cellSnapshot is the portable, JSON-serializable representation of a
+// cell's JavaScript state captured by SnapshotCell.
+//
+// Otto cannot serialize closures, so this is NOT a snapshot of the VM
+// itself: it's the enumerable own-properties of the dapp's declared
+// `state` object, plus `_status_catalog` and `context`, which status-go's
+// own JS glue relies on. RestoreCell rebuilds functions by re-running the
+// dapp's original source, then reassigns `state`, `_status_catalog` and
+// `context` from this snapshot.
+type cellSnapshot struct {
+	Source  string          `json:"source"`
+	State   json.RawMessage `json:"state,omitempty"`
+	Catalog json.RawMessage `json:"catalog,omitempty"`
+	Context json.RawMessage `json:"context,omitempty"`
+}
+
+// snapshotCaptureJS evaluates state, _status_catalog and context together in
+// a single expression, so SnapshotCell reads all three in one Cell.Run
+// round-trip. Capturing them with three separate round-trips would let JS
+// running concurrently against the same cell (a pending Send/Call, or an
+// async callback) mutate state in between reads, producing a torn snapshot
+// where state and context come from different points in time.
+const snapshotCaptureJS = `JSON.stringify({
+    state: (typeof state === 'undefined') ? null : state,
+    _status_catalog: (typeof _status_catalog === 'undefined') ? null : _status_catalog,
+    context: (typeof context === 'undefined') ? null : context
+})`
+
+// SnapshotCell serializes chatID's JavaScript state to a portable JSON
+// document, and persists it via the configured Store, if any. See
+// cellSnapshot for exactly what is and isn't captured.
+func (jail *Jail) SnapshotCell(chatID string) ([]byte, error) {
+	cell, err := jail.Cell(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	jail.RLock()
+	source := jail.sources[chatID]
+	jail.RUnlock()
+
+	captured, err := cell.Run(snapshotCaptureJS)
+	if err != nil {
+		return nil, fmt.Errorf("can't capture cell state: %s", err)
+	}
+
+	var fields struct {
+		State   json.RawMessage `json:"state"`
+		Catalog json.RawMessage `json:"_status_catalog"`
+		Context json.RawMessage `json:"context"`
+	}
+	if err := json.Unmarshal([]byte(captured.String()), &fields); err != nil {
+		return nil, fmt.Errorf("can't unmarshal captured cell state: %s", err)
+	}
+
+	snap := cellSnapshot{
+		Source:  source,
+		State:   fields.State,
+		Catalog: fields.Catalog,
+		Context: fields.Context,
+	}
+
+	out, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	if jail.store != nil {
+		if err := jail.store.Save(chatID, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// RestoreCell rehydrates chatID from a snapshot produced by SnapshotCell: it
+// re-runs the dapp's original source to rebuild its functions and
+// `_status_catalog`, then reassigns `state`, `_status_catalog` and
+// `context` from the snapshot. Any function that had been stored on
+// `state` at snapshot time is lost; only its enumerable own-properties
+// survive.
+func (jail *Jail) RestoreCell(chatID string, snap []byte) error {
+	var cs cellSnapshot
+	if err := json.Unmarshal(snap, &cs); err != nil {
+		return fmt.Errorf("can't unmarshal snapshot: %s", err)
+	}
+
+	if res := jail.Parse(chatID, cs.Source); isJailError(res) {
+		return fmt.Errorf("can't replay source: %s", res)
+	}
+
+	cell, err := jail.Cell(chatID)
+	if err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name string
+		raw  json.RawMessage
+	}{
+		{"state", cs.State},
+		{"_status_catalog", cs.Catalog},
+		{"context", cs.Context},
+	}
+	for _, f := range fields {
+		if len(f.raw) == 0 {
+			continue
+		}
+		if _, err := cell.Run(fmt.Sprintf("%s = (%s);", f.name, string(f.raw))); err != nil {
+			return fmt.Errorf("can't restore %s: %s", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseOrRestore behaves like Parse, but if a Store is configured and holds
+// a snapshot for chatID, it rehydrates the cell from that snapshot instead
+// of evaluating js. Use it on startup to resume long-lived dapp sessions
+// across process restarts; use Parse directly whenever js must run
+// unconditionally, e.g. the first time a dapp is loaded.
+func (jail *Jail) ParseOrRestore(chatID, js string) string {
+	if jail.store != nil {
+		if snap, err := jail.store.Load(chatID); err == nil {
+			if err := jail.RestoreCell(chatID, snap); err == nil {
+				return makeResult("true", nil)
+			}
+		}
+	}
+	return jail.Parse(chatID, js)
+}
+
+// SetStore configures the Store that SnapshotCell persists to and
+// ParseOrRestore rehydrates from.
+func (jail *Jail) SetStore(store Store) {
+	jail.store = store
+}
+
+// isJailError reports whether res is one of the JSONError strings returned
+// by makeError, as opposed to a successful makeResult payload.
+func isJailError(res string) bool {
+	var e JSONError
+	if err := json.Unmarshal([]byte(res), &e); err != nil {
+		return false
+	}
+	return e.Error != ""
+}
+
+// FileStore is a Store backed by one JSON file per chatID inside dir.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore that persists snapshots under dir. dir
+// must already exist.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Save implements Store.
+func (s *FileStore) Save(chatID string, snapshot []byte) error {
+	return ioutil.WriteFile(s.path(chatID), snapshot, 0600)
+}
+
+// Load implements Store.
+func (s *FileStore) Load(chatID string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(chatID))
+}
+
+func (s *FileStore) path(chatID string) string {
+	return filepath.Join(s.dir, url.QueryEscape(chatID)+".snapshot.json")
+}
@@ -0,0 +1,110 @@
+package jail
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCellSnapshotRoundTrip(t *testing.T) {
+	snap := cellSnapshot{
+		Source:  "var state = {};",
+		State:   json.RawMessage(`{"count":1}`),
+		Catalog: json.RawMessage(`{"foo":"bar"}`),
+		Context: json.RawMessage(`{"bar":"baz"}`),
+	}
+
+	out, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got cellSnapshot
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Source != snap.Source || string(got.State) != string(snap.State) ||
+		string(got.Catalog) != string(snap.Catalog) || string(got.Context) != string(snap.Context) {
+		t.Fatalf("got %+v, want %+v", got, snap)
+	}
+}
+
+func TestCellSnapshotOmitsEmptyFields(t *testing.T) {
+	snap := cellSnapshot{Source: "var state = {};"}
+
+	out, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(out, &raw); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, field := range []string{"state", "catalog", "context"} {
+		if _, ok := raw[field]; ok {
+			t.Fatalf("expected %q to be omitted when empty, got %s", field, out)
+		}
+	}
+}
+
+func TestIsJailError(t *testing.T) {
+	if !isJailError(makeError("boom")) {
+		t.Fatal("expected makeError's output to be recognized as a jail error")
+	}
+	if isJailError(makeResult(`{"ok":true}`, nil)) {
+		t.Fatal("expected makeResult's output not to be recognized as a jail error")
+	}
+	if isJailError("not json at all") {
+		t.Fatal("expected non-JSON input not to be recognized as a jail error")
+	}
+}
+
+func TestFileStoreSaveLoadRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jail-filestore")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(dir)
+	chatID := "chat/1?" // exercises url.QueryEscape in path()
+	snapshot := []byte(`{"source":"var state = {};"}`)
+
+	if err := store.Save(chatID, snapshot); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := store.Load(chatID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(got) != string(snapshot) {
+		t.Fatalf("got %s, want %s", got, snapshot)
+	}
+}
+
+func TestFileStoreLoadMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jail-filestore")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(dir)
+	if _, err := store.Load("does-not-exist"); err == nil {
+		t.Fatal("expected Load of a missing chatID to return an error")
+	}
+}
+
+func TestFileStorePathIsScopedToDir(t *testing.T) {
+	store := NewFileStore("/tmp/jail-snapshots")
+	got := store.path("chat 1")
+	want := filepath.Join("/tmp/jail-snapshots", "chat+1.snapshot.json")
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
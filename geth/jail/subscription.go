@@ -0,0 +1,185 @@
+package jail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/status-im/status-go/geth/common"
+	"github.com/status-im/status-go/geth/log"
+)
+
+// rpcSubscription is the subset of *rpc.ClientSubscription that Jail needs.
+// Declaring it locally keeps the pump loop below testable without pulling in
+// a live node connection.
+type rpcSubscription interface {
+	Err() <-chan error
+	Unsubscribe()
+}
+
+// subscription tracks a single live eth_subscribe/shh_subscribe subscription
+// opened on behalf of a cell. Notifications pushed by the node are delivered
+// back into the cell's VM as jeth.internalEmit('notification', ...) calls,
+// which are serialized through Cell.Run so they never race with JS triggered
+// from Send.
+type subscription struct {
+	id        string
+	chatID    string
+	clientSub rpcSubscription
+	quit      chan struct{}
+}
+
+// subscriptionRegistry keeps track of every subscription currently open
+// across all cells of a Jail, keyed by the id handed back to the dapp.
+type subscriptionRegistry struct {
+	mu   sync.Mutex
+	subs map[string]*subscription
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{subs: make(map[string]*subscription)}
+}
+
+func (r *subscriptionRegistry) add(sub *subscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs[sub.id] = sub
+}
+
+func (r *subscriptionRegistry) get(id string) (*subscription, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[id]
+	return sub, ok
+}
+
+// take atomically looks up id and removes it from the registry in one
+// locked step, so at most one caller ever observes ok == true for a given
+// id. Unsubscribe relies on this to decide who gets to close sub.quit:
+// without it, two concurrent eth_unsubscribe calls for the same id could
+// both see the subscription and both close sub.quit, and the second close
+// would panic.
+func (r *subscriptionRegistry) take(id string) (*subscription, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[id]
+	if ok {
+		delete(r.subs, id)
+	}
+	return sub, ok
+}
+
+func (r *subscriptionRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subs, id)
+}
+
+var subIDSeq uint64
+
+// nextSubscriptionID produces the id surfaced to JS for eth_subscribe and
+// shh_subscribe calls. It only needs to be unique within this process.
+func nextSubscriptionID() string {
+	return fmt.Sprintf("0x%x", atomic.AddUint64(&subIDSeq, 1))
+}
+
+// Subscribe opens req (an eth_subscribe or shh_subscribe call) against the
+// underlying node on behalf of chatID and starts pumping eth_subscription
+// notifications back into the originating cell for as long as the
+// subscription stays open. It returns the subscription id to hand back to
+// the dapp.
+func (jail *Jail) Subscribe(chatID string, req common.RPCCall) (string, error) {
+	jailCell, err := jail.Cell(chatID)
+	if err != nil {
+		return "", err
+	}
+	cell, ok := jailCell.(*Cell)
+	if !ok {
+		return "", fmt.Errorf("cell[%s] is not a *Cell", chatID)
+	}
+
+	client := jail.nodeManager.RPCClient()
+	if client == nil {
+		return "", ErrInvalidJail
+	}
+
+	namespace := "eth"
+	if req.Method == "shh_subscribe" {
+		namespace = "shh"
+	}
+
+	ch := make(chan json.RawMessage, 64)
+	clientSub, err := client.Subscribe(context.Background(), namespace, ch, req.Params...)
+	if err != nil {
+		return "", err
+	}
+
+	sub := &subscription{
+		id:        nextSubscriptionID(),
+		chatID:    chatID,
+		clientSub: clientSub,
+		quit:      make(chan struct{}),
+	}
+	jail.subs.add(sub)
+
+	go jail.pumpNotifications(cell, sub, ch)
+
+	return sub.id, nil
+}
+
+// Unsubscribe tears down a subscription previously opened with Subscribe.
+func (jail *Jail) Unsubscribe(req common.RPCCall) error {
+	if len(req.Params) == 0 {
+		return fmt.Errorf("eth_unsubscribe: missing subscription id")
+	}
+	id, ok := req.Params[0].(string)
+	if !ok {
+		return fmt.Errorf("eth_unsubscribe: subscription id must be a string")
+	}
+
+	sub, ok := jail.subs.take(id)
+	if !ok {
+		return fmt.Errorf("eth_unsubscribe: unknown subscription %s", id)
+	}
+
+	close(sub.quit)
+	return nil
+}
+
+// pumpNotifications forwards every value received on ch into cell's VM as an
+// eth_subscription notification, until the subscription is cancelled, the
+// node drops it, or ch is closed.
+func (jail *Jail) pumpNotifications(cell *Cell, sub *subscription, ch <-chan json.RawMessage) {
+	defer jail.subs.remove(sub.id)
+	defer sub.clientSub.Unsubscribe()
+
+	if err := emitProviderEvent(cell, "connect", sub.id); err != nil {
+		log.Error("failed to emit connect event", "chatID", sub.chatID, "subscription", sub.id, "error", err)
+	}
+	defer func() {
+		if err := emitProviderEvent(cell, "disconnect", sub.id); err != nil {
+			log.Error("failed to emit disconnect event", "chatID", sub.chatID, "subscription", sub.id, "error", err)
+		}
+	}()
+
+	for {
+		select {
+		case result, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := deliverNotification(cell, sub.id, result); err != nil {
+				log.Error("failed to deliver eth_subscription notification", "chatID", sub.chatID, "subscription", sub.id, "error", err)
+			}
+		case err := <-sub.clientSub.Err():
+			if err != nil {
+				log.Error("subscription dropped", "chatID", sub.chatID, "subscription", sub.id, "error", err)
+			}
+			return
+		case <-sub.quit:
+			return
+		}
+	}
+}
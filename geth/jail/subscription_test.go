@@ -0,0 +1,88 @@
+package jail
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSubscriptionRegistryTakeIsAtomic(t *testing.T) {
+	r := newSubscriptionRegistry()
+	sub := &subscription{id: "0x1", chatID: "chat-1", quit: make(chan struct{})}
+	r.add(sub)
+
+	const attempts = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := r.take(sub.id); ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Fatalf("expected exactly one concurrent take() to succeed, got %d", winners)
+	}
+
+	if _, ok := r.get(sub.id); ok {
+		t.Fatal("take() must remove the subscription from the registry")
+	}
+}
+
+func TestSubscriptionRegistryTakeThenGetMissing(t *testing.T) {
+	r := newSubscriptionRegistry()
+	sub := &subscription{id: "0x2", chatID: "chat-1", quit: make(chan struct{})}
+	r.add(sub)
+
+	got, ok := r.take(sub.id)
+	if !ok || got != sub {
+		t.Fatalf("expected take() to return the added subscription, got %v, %v", got, ok)
+	}
+
+	if _, ok := r.take(sub.id); ok {
+		t.Fatal("a second take() of the same id must report ok == false")
+	}
+}
+
+// TestConcurrentUnsubscribeClosesQuitOnce exercises the scenario from Jail.Unsubscribe: two
+// concurrent callers racing to tear down the same subscription id must
+// agree on exactly one winner, so only one of them ever closes sub.quit.
+func TestConcurrentUnsubscribeClosesQuitOnce(t *testing.T) {
+	r := newSubscriptionRegistry()
+	sub := &subscription{id: "0x3", chatID: "chat-1", quit: make(chan struct{})}
+	r.add(sub)
+
+	unsubscribe := func() (closed bool) {
+		s, ok := r.take(sub.id)
+		if !ok {
+			return false
+		}
+		close(s.quit)
+		return true
+	}
+
+	var wg sync.WaitGroup
+	results := make([]bool, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = unsubscribe()
+		}()
+	}
+	wg.Wait()
+
+	if results[0] == results[1] {
+		t.Fatalf("expected exactly one of the two racing unsubscribes to win, got %v", results)
+	}
+}